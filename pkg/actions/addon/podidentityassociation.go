@@ -0,0 +1,814 @@
+package addon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	ekstypes "github.com/aws/aws-sdk-go-v2/service/eks/types"
+
+	api "github.com/weaveworks/eksctl/pkg/apis/eksctl.io/v1alpha5"
+	"github.com/weaveworks/eksctl/pkg/cfn/manager"
+)
+
+// defaultConcurrency is how many pod identity associations PodIdentityAssociationUpdater
+// reconciles at once when Concurrency is not set.
+const defaultConcurrency = 5
+
+// defaultRateLimit and defaultRateBurst bound the EKS and CloudFormation describe/list calls
+// UpdateRole and Prune make when RateLimiter is not set, to stay under API throttling limits when
+// reconciling many associations concurrently.
+const (
+	defaultRateLimit = rate.Limit(10)
+	defaultRateBurst = 5
+)
+
+// IAMRoleCreator creates an IAM role (and the backing CloudFormation stack) for a pod identity
+// association that does not have one yet.
+type IAMRoleCreator interface {
+	Create(ctx context.Context, podIdentityAssociation *api.PodIdentityAssociation, addonName string) (roleARN string, err error)
+}
+
+// IAMRoleUpdater reconciles the IAM role backing an eksctl-managed pod identity association.
+type IAMRoleUpdater interface {
+	Update(ctx context.Context, podIdentityAssociation api.PodIdentityAssociation, stackName, associationID string) (roleARN string, updated bool, err error)
+}
+
+// EKSPodIdentityDescriber describes the subset of the EKS API used to look up existing pod
+// identity associations.
+type EKSPodIdentityDescriber interface {
+	ListPodIdentityAssociations(ctx context.Context, params *eks.ListPodIdentityAssociationsInput, optFns ...func(*eks.Options)) (*eks.ListPodIdentityAssociationsOutput, error)
+	DescribePodIdentityAssociation(ctx context.Context, params *eks.DescribePodIdentityAssociationInput, optFns ...func(*eks.Options)) (*eks.DescribePodIdentityAssociationOutput, error)
+}
+
+// StackDescriber describes a single CloudFormation stack.
+type StackDescriber interface {
+	DescribeStack(ctx context.Context, stack *manager.Stack) (*manager.Stack, error)
+}
+
+// PodIdentityAssociationUpdater creates or updates the IAM roles backing an addon's pod identity
+// associations, reconciling them against what already exists in the cluster.
+type PodIdentityAssociationUpdater struct {
+	ClusterName             string
+	IAMRoleCreator          IAMRoleCreator
+	IAMRoleUpdater          IAMRoleUpdater
+	EKSPodIdentityDescriber EKSPodIdentityDescriber
+	StackDescriber          StackDescriber
+	// IRSARoleFinder is required when a pod identity association declares the irsa-fallback
+	// identity owner; it is unused otherwise.
+	IRSARoleFinder IRSARoleFinder
+	// TrustPolicyUpdater is consulted when converting an IRSA role into a pod identity association;
+	// it is unused otherwise.
+	TrustPolicyUpdater TrustPolicyUpdater
+	// ServiceAccountInspector, when set, gates UpdateRole to only create or update associations for
+	// service accounts carrying the managed-pod-identity opt-in annotation. When nil, gating is
+	// disabled and every association is reconciled.
+	ServiceAccountInspector ServiceAccountInspector
+	// Concurrency bounds how many associations UpdateRole reconciles at once. Defaults to
+	// defaultConcurrency when zero or negative.
+	Concurrency int
+	// RateLimiter throttles the EKS and CloudFormation describe/list calls UpdateRole and Prune
+	// make, to stay under API throttling limits when reconciling many associations concurrently.
+	// Defaults to defaultRateLimit/defaultRateBurst when unset.
+	RateLimiter *rate.Limiter
+	// rateLimiterOnce guards the lazy default-initialization of RateLimiter in waitForRateLimiter,
+	// which is called concurrently by UpdateRole's reconcile goroutines.
+	rateLimiterOnce sync.Once
+	// StackLister discovers pod identity role stacks left behind by associations that were removed
+	// from the addon config. Required by Prune.
+	StackLister StackLister
+	// StackDeleter deletes an orphaned, eksctl-owned pod identity role stack. Required by Prune when
+	// PruneOptions.Delete is set.
+	StackDeleter StackDeleter
+	// PodIdentityAssociationDeleter deletes an orphaned pod identity association from EKS. Required
+	// by Prune when PruneOptions.Delete is set.
+	PodIdentityAssociationDeleter PodIdentityAssociationDeleter
+}
+
+// StackLister discovers CloudFormation stacks by name, used by Prune to find pod identity role
+// stacks that no longer correspond to a desired association.
+//
+//go:generate mockery --name=StackLister --output=mocks --outpkg=mocks --filename=stack_lister.go
+type StackLister interface {
+	ListStacksMatching(ctx context.Context, nameRegex string, statusFilters ...string) ([]*manager.Stack, error)
+}
+
+// StackDeleter deletes a CloudFormation stack.
+//
+//go:generate mockery --name=StackDeleter --output=mocks --outpkg=mocks --filename=stack_deleter.go
+type StackDeleter interface {
+	DeleteStack(ctx context.Context, stack *manager.Stack) error
+}
+
+// PodIdentityAssociationDeleter deletes a live pod identity association from EKS.
+//
+//go:generate mockery --name=PodIdentityAssociationDeleter --output=mocks --outpkg=mocks --filename=pod_identity_association_deleter.go
+type PodIdentityAssociationDeleter interface {
+	DeletePodIdentityAssociation(ctx context.Context, associationID string) error
+}
+
+// PruneOptions controls the behaviour of PodIdentityAssociationUpdater.Prune.
+type PruneOptions struct {
+	// Delete, when true, deletes orphaned pod identity associations and, for eksctl-owned ones,
+	// their backing CloudFormation stack. An orphan whose association no longer exists in EKS is
+	// only reported; its stack is not deleted. When false, Prune only reports what it found. Callers
+	// should only set this in response to an explicit opt-in, such as an `--prune` CLI flag.
+	//
+	// Wiring that flag into `eksctl update addon` is tracked as follow-up work in cmd/cmdutils,
+	// which this package does not depend on and cannot reach from here.
+	Delete bool
+}
+
+// OrphanedAssociation describes a pod identity role stack, and the live pod identity association
+// for it if any, that no longer has a corresponding entry in the addon's desired associations.
+// When no association exists in EKS any more, only the namespace, service account, stack name and
+// reason are set.
+type OrphanedAssociation struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	AssociationID  string `json:"associationId,omitempty"`
+	RoleARN        string `json:"roleARN,omitempty"`
+	StackName      string `json:"stackName,omitempty"`
+	EksctlManaged  bool   `json:"eksctlManaged"`
+	Deleted        bool   `json:"deleted"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// PruneResult is the outcome of Prune: every orphaned association it found, whether or not
+// PruneOptions.Delete was set.
+type PruneResult struct {
+	Orphans []OrphanedAssociation `json:"orphans"`
+}
+
+// Identity owners a pod identity association can declare, mirroring api.PodIdentityAssociationOwner.
+// The owner determines whether UpdateRole manages the backing IAM role itself, defers to a
+// user-supplied one, or adopts an existing IRSA role.
+const (
+	identityOwnerEksctl       = api.PodIdentityAssociationOwnerEksctl
+	identityOwnerExternal     = api.PodIdentityAssociationOwnerExternal
+	identityOwnerIRSAFallback = api.PodIdentityAssociationOwnerIRSAFallback
+)
+
+// podIdentityPrincipal is the service principal pod identity associations trust, as opposed to the
+// OIDC provider trusted by IRSA roles.
+const podIdentityPrincipal = "pods.eks.amazonaws.com"
+
+// IRSARoleFinder looks up the IAM role already associated with a service account via IRSA (IAM
+// Roles for Service Accounts), so it can be adopted as a pod identity association.
+//
+//go:generate mockery --name=IRSARoleFinder --output=mocks --outpkg=mocks --filename=irsa_role_finder.go
+type IRSARoleFinder interface {
+	FindIRSARole(ctx context.Context, namespace, serviceAccountName string) (roleARN string, err error)
+}
+
+// TrustPolicyUpdater rewrites an IAM role's trust policy to trust the given principal, used to
+// convert an IRSA role's OIDC trust relationship into a pod identity one.
+//
+//go:generate mockery --name=TrustPolicyUpdater --output=mocks --outpkg=mocks --filename=trust_policy_updater.go
+type TrustPolicyUpdater interface {
+	UpdateTrustPolicy(ctx context.Context, roleARN, principal string) error
+}
+
+// ProviderTransition records a pod identity association whose managing identity provider changed
+// as a result of UpdateRole, so the addon reconciler can log it.
+type ProviderTransition struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	From           string `json:"from"`
+	To             string `json:"to"`
+}
+
+// RoleAction describes what UpdateRole did, or would do, for a single pod identity association.
+type RoleAction string
+
+const (
+	// RoleActionCreate means a new IAM role and CloudFormation stack will be created.
+	RoleActionCreate RoleAction = "create"
+	// RoleActionUpdate means an existing eksctl-managed IAM role will be updated.
+	RoleActionUpdate RoleAction = "update"
+	// RoleActionUnchanged means the association's role is user-supplied and is left untouched.
+	RoleActionUnchanged RoleAction = "unchanged"
+	// RoleActionConflict means the association cannot be reconciled as requested: the requested
+	// roleARN conflicts with a role eksctl already owns, a required roleARN is missing, or a
+	// required IRSARoleFinder or TrustPolicyUpdater is not configured. Conflict holds the reason.
+	RoleActionConflict RoleAction = "conflict"
+	// RoleActionSkipped means the association's service account did not match the configured
+	// opt-in selector, so it was left untouched.
+	RoleActionSkipped RoleAction = "skipped"
+)
+
+// managedPodIdentityAnnotation opts a service account in to having eksctl create or update pod
+// identity associations for it, so eksctl does not stomp on service accounts owned by other
+// tooling on a shared cluster.
+const managedPodIdentityAnnotation = "eksctl.io/managed-pod-identity"
+
+// ServiceAccountInspector reports whether a service account has opted in to eksctl-managed pod
+// identity associations.
+//
+//go:generate mockery --name=ServiceAccountInspector --output=mocks --outpkg=mocks --filename=service_account_inspector.go
+type ServiceAccountInspector interface {
+	HasManagedPodIdentityAnnotation(ctx context.Context, namespace, serviceAccountName string) (bool, error)
+}
+
+// SkippedAssociation records a pod identity association UpdateRole left untouched because its
+// service account did not match the configured opt-in selector.
+type SkippedAssociation struct {
+	Namespace      string `json:"namespace"`
+	ServiceAccount string `json:"serviceAccount"`
+	Reason         string `json:"reason"`
+}
+
+// UpdateResult is the outcome of UpdateRole: the associations to submit to the EKS addon API,
+// alongside any that were skipped because their service account was not opted in.
+type UpdateResult struct {
+	AddonPodIdentityAssociations []ekstypes.AddonPodIdentityAssociations `json:"addonPodIdentityAssociations"`
+	Skipped                      []SkippedAssociation                    `json:"skipped,omitempty"`
+}
+
+// PodIdentityRolePlan describes the action UpdateRole took, or would take in dry-run mode, for a
+// single pod identity association.
+type PodIdentityRolePlan struct {
+	Namespace      string     `json:"namespace"`
+	ServiceAccount string     `json:"serviceAccount"`
+	IdentityOwner  string     `json:"identityOwner,omitempty"`
+	Action         RoleAction `json:"action"`
+	StackName      string     `json:"stackName,omitempty"`
+	StackAction    RoleAction `json:"stackAction,omitempty"`
+	RoleARN        string     `json:"roleARN,omitempty"`
+	Conflict       string     `json:"conflict,omitempty"`
+}
+
+// UpdateRolePlan is the structured outcome of UpdateRole. UpdateRole does not return it; it is
+// copied into the target passed to WithPlan, whether or not dry-run is enabled, so callers can
+// inspect it, print it, or gate a CI pipeline on it.
+//
+// Printing String() (or the raw JSON() bytes) from a `--dry-run`/`-o json` flag on `eksctl update
+// addon` is tracked as follow-up work in cmd/cmdutils, which this package does not depend on and
+// cannot reach from here.
+type UpdateRolePlan struct {
+	ClusterName                  string                                   `json:"clusterName"`
+	Roles                        []PodIdentityRolePlan                   `json:"roles"`
+	AddonPodIdentityAssociations []ekstypes.AddonPodIdentityAssociations `json:"addonPodIdentityAssociations"`
+	ProviderTransitions          []ProviderTransition                     `json:"providerTransitions,omitempty"`
+}
+
+// String renders the plan in a human-readable form.
+func (p *UpdateRolePlan) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "pod identity association plan for cluster %q:\n", p.ClusterName)
+	for _, role := range p.Roles {
+		switch role.Action {
+		case RoleActionCreate:
+			fmt.Fprintf(&sb, "  - would create role for %s/%s (stack %s)\n", role.Namespace, role.ServiceAccount, role.StackName)
+		case RoleActionUpdate:
+			fmt.Fprintf(&sb, "  - would update role for %s/%s (stack %s)\n", role.Namespace, role.ServiceAccount, role.StackName)
+		case RoleActionConflict:
+			fmt.Fprintf(&sb, "  - conflict for %s/%s: %s\n", role.Namespace, role.ServiceAccount, role.Conflict)
+		case RoleActionSkipped:
+			fmt.Fprintf(&sb, "  - skipped %s/%s: %s\n", role.Namespace, role.ServiceAccount, role.Conflict)
+		default:
+			fmt.Fprintf(&sb, "  - %s/%s is unchanged (user-supplied roleARN)\n", role.Namespace, role.ServiceAccount)
+		}
+	}
+	return sb.String()
+}
+
+// JSON renders the plan as indented JSON.
+func (p *UpdateRolePlan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// UpdateOptions controls the behaviour of PodIdentityAssociationUpdater.UpdateRole.
+type UpdateOptions struct {
+	// DryRun, when true, makes UpdateRole compute and return a plan without creating or updating
+	// any IAM roles or CloudFormation stacks.
+	DryRun bool
+	// Plan, when non-nil, receives the plan that was computed, whether or not DryRun is set.
+	Plan *UpdateRolePlan
+}
+
+// UpdateOption configures UpdateOptions.
+type UpdateOption func(*UpdateOptions)
+
+// WithDryRun makes UpdateRole compute and return a plan without performing any AWS mutations.
+func WithDryRun() UpdateOption {
+	return func(o *UpdateOptions) {
+		o.DryRun = true
+	}
+}
+
+// WithPlan captures the plan that UpdateRole computes, even when DryRun is not set, so callers can
+// inspect what changed after the fact.
+func WithPlan(plan *UpdateRolePlan) UpdateOption {
+	return func(o *UpdateOptions) {
+		o.Plan = plan
+	}
+}
+
+// podIdentityReconciliation is the outcome of reconciling a single pod identity association,
+// stashed by index so concurrent workers can be collected back into input order.
+type podIdentityReconciliation struct {
+	skip        *SkippedAssociation
+	rolePlan    PodIdentityRolePlan
+	transition  *ProviderTransition
+	association *ekstypes.AddonPodIdentityAssociations
+}
+
+// UpdateRole creates or updates the IAM roles backing podIdentityAssociations, returning the
+// UpdateResult that should be submitted to the EKS addon API. Associations are reconciled
+// concurrently, bounded by Concurrency, but UpdateResult and the returned plan always preserve the
+// input order.
+//
+// When WithDryRun is supplied, no IAM roles or CloudFormation stacks are created or updated; the
+// returned result instead reflects what UpdateRole would have submitted (an association whose role
+// would be created carries an empty RoleArn, as no role exists yet), and the plan describing
+// the reasoning behind it can be retrieved with WithPlan.
+//
+// When ServiceAccountInspector is set, associations whose service account has not opted in via the
+// managed-pod-identity annotation are left untouched and reported in UpdateResult.Skipped rather
+// than failing the call.
+//
+// If reconciling any one association fails, the remaining in-flight associations are cancelled and
+// UpdateRole returns that error.
+func (u *PodIdentityAssociationUpdater) UpdateRole(ctx context.Context, podIdentityAssociations []api.PodIdentityAssociation, addonName string, opts ...UpdateOption) (*UpdateResult, error) {
+	options := UpdateOptions{}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	concurrency := u.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+
+	reconciliations := make([]podIdentityReconciliation, len(podIdentityAssociations))
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(concurrency)
+
+	for i, pia := range podIdentityAssociations {
+		group.Go(func() error {
+			reconciliation, err := u.reconcileOne(groupCtx, pia, addonName, options.DryRun)
+			if err != nil {
+				return err
+			}
+			reconciliations[i] = reconciliation
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	plan := &UpdateRolePlan{ClusterName: u.ClusterName}
+	result := &UpdateResult{}
+	for _, reconciliation := range reconciliations {
+		plan.Roles = append(plan.Roles, reconciliation.rolePlan)
+		if reconciliation.transition != nil {
+			plan.ProviderTransitions = append(plan.ProviderTransitions, *reconciliation.transition)
+		}
+		if reconciliation.skip != nil {
+			result.Skipped = append(result.Skipped, *reconciliation.skip)
+			continue
+		}
+		if reconciliation.association != nil {
+			result.AddonPodIdentityAssociations = append(result.AddonPodIdentityAssociations, *reconciliation.association)
+			plan.AddonPodIdentityAssociations = append(plan.AddonPodIdentityAssociations, *reconciliation.association)
+		}
+	}
+
+	if options.Plan != nil {
+		*options.Plan = *plan
+	}
+
+	return result, nil
+}
+
+// reconcileOne resolves the outcome for a single pod identity association, either skipping it
+// because its service account has not opted in, or resolving the roleARN that backs it.
+func (u *PodIdentityAssociationUpdater) reconcileOne(ctx context.Context, pia api.PodIdentityAssociation, addonName string, dryRun bool) (podIdentityReconciliation, error) {
+	managed, err := u.isServiceAccountManaged(ctx, pia)
+	if err != nil {
+		return podIdentityReconciliation{}, err
+	}
+	if !managed {
+		reason := fmt.Sprintf("service account %s/%s is missing the %q annotation; skipping", pia.Namespace, pia.ServiceAccountName, managedPodIdentityAnnotation)
+		return podIdentityReconciliation{
+			skip: &SkippedAssociation{
+				Namespace:      pia.Namespace,
+				ServiceAccount: pia.ServiceAccountName,
+				Reason:         reason,
+			},
+			rolePlan: PodIdentityRolePlan{
+				Namespace:      pia.Namespace,
+				ServiceAccount: pia.ServiceAccountName,
+				IdentityOwner:  string(pia.IdentityOwner),
+				Action:         RoleActionSkipped,
+				Conflict:       reason,
+			},
+		}, nil
+	}
+
+	roleARN, rolePlan, transition, err := u.resolveRoleARN(ctx, pia, addonName, dryRun)
+	if err != nil {
+		return podIdentityReconciliation{}, err
+	}
+	reconciliation := podIdentityReconciliation{rolePlan: rolePlan, transition: transition}
+	if rolePlan.Action != RoleActionConflict {
+		reconciliation.association = &ekstypes.AddonPodIdentityAssociations{
+			ServiceAccount: aws.String(pia.ServiceAccountName),
+			RoleArn:        aws.String(roleARN),
+		}
+	}
+	return reconciliation, nil
+}
+
+// Prune finds pod identity associations that UpdateRole previously created for addonName but that
+// no longer appear in desired, because their entry was removed from the addon config. Orphans are
+// always reported; they are only deleted when options.Delete is set.
+func (u *PodIdentityAssociationUpdater) Prune(ctx context.Context, desired []api.PodIdentityAssociation, addonName string, options PruneOptions) (*PruneResult, error) {
+	desiredServiceAccounts := make(map[string]bool, len(desired))
+	for _, pia := range desired {
+		desiredServiceAccounts[pia.Namespace+"/"+pia.ServiceAccountName] = true
+	}
+
+	stackPrefix := podIdentityRoleStackPrefix(u.ClusterName, addonName)
+	stacks, err := u.StackLister.ListStacksMatching(ctx, "^"+regexp.QuoteMeta(stackPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("listing pod identity role stacks for addon %q: %w", addonName, err)
+	}
+
+	result := &PruneResult{}
+	for _, stack := range stacks {
+		stackName := aws.ToString(stack.StackName)
+		namespace, serviceAccountName, ok := parsePodIdentityRoleStackSuffix(stackName, stackPrefix)
+		if !ok || desiredServiceAccounts[namespace+"/"+serviceAccountName] {
+			continue
+		}
+
+		orphan, err := u.resolveOrphan(ctx, stackName, namespace, serviceAccountName, options)
+		if err != nil {
+			return nil, err
+		}
+		result.Orphans = append(result.Orphans, orphan)
+	}
+
+	return result, nil
+}
+
+// resolveOrphan reports, and optionally deletes, a single orphaned pod identity association and
+// the stack backing it.
+func (u *PodIdentityAssociationUpdater) resolveOrphan(ctx context.Context, stackName, namespace, serviceAccountName string, options PruneOptions) (OrphanedAssociation, error) {
+	orphan := OrphanedAssociation{
+		Namespace:      namespace,
+		ServiceAccount: serviceAccountName,
+		StackName:      stackName,
+	}
+
+	if err := u.waitForRateLimiter(ctx); err != nil {
+		return orphan, err
+	}
+	output, err := u.EKSPodIdentityDescriber.ListPodIdentityAssociations(ctx, &eks.ListPodIdentityAssociationsInput{
+		ClusterName:    aws.String(u.ClusterName),
+		Namespace:      aws.String(namespace),
+		ServiceAccount: aws.String(serviceAccountName),
+	})
+	if err != nil {
+		return orphan, fmt.Errorf("listing pod identity associations for %s/%s: %w", namespace, serviceAccountName, err)
+	}
+	if len(output.Associations) == 0 {
+		orphan.Reason = "pod identity association no longer exists"
+		return orphan, nil
+	}
+
+	summary := output.Associations[0]
+	orphan.AssociationID = aws.ToString(summary.AssociationId)
+
+	currentRoleARN, err := u.describeCurrentRoleARN(ctx, orphan.AssociationID)
+	if err != nil {
+		return orphan, err
+	}
+	orphan.RoleARN = currentRoleARN
+
+	isEksctlManaged, err := u.isStackOwned(ctx, stackName)
+	if err != nil {
+		return orphan, err
+	}
+	orphan.EksctlManaged = isEksctlManaged
+
+	if !options.Delete {
+		orphan.Reason = "orphaned; re-run with --prune to delete"
+		return orphan, nil
+	}
+
+	if u.PodIdentityAssociationDeleter == nil {
+		return orphan, fmt.Errorf("PodIdentityAssociationDeleter is required when PruneOptions.Delete is set")
+	}
+	if err := u.PodIdentityAssociationDeleter.DeletePodIdentityAssociation(ctx, orphan.AssociationID); err != nil {
+		return orphan, fmt.Errorf("deleting pod identity association %s: %w", orphan.AssociationID, err)
+	}
+
+	if !isEksctlManaged {
+		orphan.Reason = "no eksctl-owned stack was found for this role; only the pod identity association was deleted, the IAM role was left untouched"
+		orphan.Deleted = true
+		return orphan, nil
+	}
+
+	if u.StackDeleter == nil {
+		return orphan, fmt.Errorf("StackDeleter is required when PruneOptions.Delete is set")
+	}
+	if err := u.StackDeleter.DeleteStack(ctx, &manager.Stack{StackName: aws.String(stackName)}); err != nil {
+		return orphan, fmt.Errorf("deleting stack %s: %w", stackName, err)
+	}
+	orphan.Deleted = true
+
+	return orphan, nil
+}
+
+// isServiceAccountManaged reports whether pia's service account should be reconciled, consulting
+// ServiceAccountInspector when one is configured. With no inspector configured, every association
+// is managed.
+func (u *PodIdentityAssociationUpdater) isServiceAccountManaged(ctx context.Context, pia api.PodIdentityAssociation) (bool, error) {
+	if u.ServiceAccountInspector == nil {
+		return true, nil
+	}
+	managed, err := u.ServiceAccountInspector.HasManagedPodIdentityAnnotation(ctx, pia.Namespace, pia.ServiceAccountName)
+	if err != nil {
+		return false, fmt.Errorf("checking managed-pod-identity annotation for %s/%s: %w", pia.Namespace, pia.ServiceAccountName, err)
+	}
+	return managed, nil
+}
+
+// resolveRoleARN determines the roleARN that should back a single pod identity association, along
+// with the plan describing how it got there and, if its managing provider changed, a
+// ProviderTransition. When dryRun is true, IAMRoleCreator.Create, IAMRoleUpdater.Update and
+// TrustPolicyUpdater.UpdateTrustPolicy are never called.
+func (u *PodIdentityAssociationUpdater) resolveRoleARN(ctx context.Context, pia api.PodIdentityAssociation, addonName string, dryRun bool) (string, PodIdentityRolePlan, *ProviderTransition, error) {
+	rolePlan := PodIdentityRolePlan{
+		Namespace:      pia.Namespace,
+		ServiceAccount: pia.ServiceAccountName,
+		IdentityOwner:  string(pia.IdentityOwner),
+	}
+
+	switch pia.IdentityOwner {
+	case identityOwnerExternal:
+		roleARN, err := u.resolveExternalRoleARN(pia, &rolePlan)
+		return roleARN, rolePlan, nil, err
+	case identityOwnerIRSAFallback:
+		// An association already present in EKS was, by definition, already adopted by a prior
+		// reconcile; only report a transition the first time a pod identity association is
+		// created for this service account, since that is the moment the role's trust policy
+		// actually moves from trusting the OIDC provider to trusting pod identity.
+		existingAssociationID, err := u.findAssociationID(ctx, pia)
+		if err != nil {
+			return "", rolePlan, nil, err
+		}
+		roleARN, err := u.resolveIRSAFallbackRoleARN(ctx, pia, &rolePlan, dryRun)
+		if err != nil {
+			// No role was found or adopted, so nothing transitioned.
+			return roleARN, rolePlan, nil, err
+		}
+		if existingAssociationID != "" {
+			return roleARN, rolePlan, nil, nil
+		}
+		transition := &ProviderTransition{
+			Namespace:      pia.Namespace,
+			ServiceAccount: pia.ServiceAccountName,
+			From:           string(identityOwnerIRSAFallback),
+			To:             string(identityOwnerEksctl),
+		}
+		return roleARN, rolePlan, transition, nil
+	default:
+		roleARN, err := u.resolveEksctlManagedRoleARN(ctx, pia, addonName, &rolePlan, dryRun)
+		return roleARN, rolePlan, nil, err
+	}
+}
+
+// resolveExternalRoleARN passes through a user-supplied roleARN for an association whose identity
+// is entirely owned outside of eksctl; no CFN stack or EKS API calls are made.
+func (u *PodIdentityAssociationUpdater) resolveExternalRoleARN(pia api.PodIdentityAssociation, rolePlan *PodIdentityRolePlan) (string, error) {
+	if pia.RoleARN == "" {
+		err := fmt.Errorf("podIdentityAssociation.roleARN is required when identityOwner is %q", identityOwnerExternal)
+		rolePlan.Action = RoleActionConflict
+		rolePlan.Conflict = err.Error()
+		return "", err
+	}
+	rolePlan.Action = RoleActionUnchanged
+	rolePlan.RoleARN = pia.RoleARN
+	return pia.RoleARN, nil
+}
+
+// resolveIRSAFallbackRoleARN adopts an existing IRSA role for the service account, rewriting its
+// trust policy to trust pod identity instead of the cluster's OIDC provider.
+func (u *PodIdentityAssociationUpdater) resolveIRSAFallbackRoleARN(ctx context.Context, pia api.PodIdentityAssociation, rolePlan *PodIdentityRolePlan, dryRun bool) (string, error) {
+	if u.IRSARoleFinder == nil {
+		err := fmt.Errorf("IRSARoleFinder is required when identityOwner is %q", identityOwnerIRSAFallback)
+		rolePlan.Action = RoleActionConflict
+		rolePlan.Conflict = err.Error()
+		return "", err
+	}
+	roleARN, err := u.IRSARoleFinder.FindIRSARole(ctx, pia.Namespace, pia.ServiceAccountName)
+	if err != nil {
+		return "", fmt.Errorf("finding IRSA role for %s/%s: %w", pia.Namespace, pia.ServiceAccountName, err)
+	}
+	rolePlan.Action = RoleActionUpdate
+	rolePlan.RoleARN = roleARN
+	if dryRun {
+		return roleARN, nil
+	}
+	if u.TrustPolicyUpdater == nil {
+		err := fmt.Errorf("TrustPolicyUpdater is required when identityOwner is %q", identityOwnerIRSAFallback)
+		rolePlan.Action = RoleActionConflict
+		rolePlan.Conflict = err.Error()
+		return "", err
+	}
+	if err := u.TrustPolicyUpdater.UpdateTrustPolicy(ctx, roleARN, podIdentityPrincipal); err != nil {
+		return "", fmt.Errorf("updating trust policy for role %s: %w", roleARN, err)
+	}
+	return roleARN, nil
+}
+
+// resolveEksctlManagedRoleARN implements the default eksctl-managed ownership model: a PIA's IAM
+// role and CFN stack are created and updated by eksctl, and a user-supplied roleARN is only
+// accepted when it matches the role eksctl already created.
+func (u *PodIdentityAssociationUpdater) resolveEksctlManagedRoleARN(ctx context.Context, pia api.PodIdentityAssociation, addonName string, rolePlan *PodIdentityRolePlan, dryRun bool) (string, error) {
+	associationID, err := u.findAssociationID(ctx, pia)
+	if err != nil {
+		return "", err
+	}
+
+	if associationID == "" {
+		if pia.RoleARN != "" {
+			rolePlan.Action = RoleActionUnchanged
+			rolePlan.RoleARN = pia.RoleARN
+			return pia.RoleARN, nil
+		}
+		stackName := podIdentityRoleStackName(u.ClusterName, addonName, pia.Namespace, pia.ServiceAccountName)
+		rolePlan.Action = RoleActionCreate
+		rolePlan.StackName = stackName
+		rolePlan.StackAction = RoleActionCreate
+		if dryRun {
+			return "", nil
+		}
+		roleARN, err := u.IAMRoleCreator.Create(ctx, &pia, addonName)
+		rolePlan.RoleARN = roleARN
+		return roleARN, err
+	}
+
+	currentRoleARN, err := u.describeCurrentRoleARN(ctx, associationID)
+	if err != nil {
+		return "", err
+	}
+
+	stackName := podIdentityRoleStackName(u.ClusterName, addonName, pia.Namespace, pia.ServiceAccountName)
+	rolePlan.StackName = stackName
+	isEksctlManaged, err := u.isStackOwned(ctx, stackName)
+	if err != nil {
+		return "", err
+	}
+
+	if !isEksctlManaged {
+		if pia.RoleARN == "" {
+			err := fmt.Errorf("podIdentityAssociation.roleARN is required since the role was not created by eksctl")
+			rolePlan.Action = RoleActionConflict
+			rolePlan.Conflict = err.Error()
+			if dryRun {
+				return "", nil
+			}
+			return "", err
+		}
+		rolePlan.Action = RoleActionUnchanged
+		rolePlan.RoleARN = pia.RoleARN
+		return pia.RoleARN, nil
+	}
+
+	if pia.RoleARN != "" && pia.RoleARN != currentRoleARN {
+		err := fmt.Errorf("cannot change podIdentityAssociation.roleARN since the role was created by eksctl")
+		rolePlan.Action = RoleActionConflict
+		rolePlan.Conflict = err.Error()
+		rolePlan.RoleARN = currentRoleARN
+		if dryRun {
+			return "", nil
+		}
+		return "", err
+	}
+
+	rolePlan.Action = RoleActionUpdate
+	rolePlan.StackAction = RoleActionUpdate
+	if dryRun {
+		rolePlan.RoleARN = currentRoleARN
+		return currentRoleARN, nil
+	}
+
+	roleARN, _, err := u.IAMRoleUpdater.Update(ctx, pia, stackName, associationID)
+	rolePlan.RoleARN = roleARN
+	return roleARN, err
+}
+
+func (u *PodIdentityAssociationUpdater) findAssociationID(ctx context.Context, pia api.PodIdentityAssociation) (string, error) {
+	if err := u.waitForRateLimiter(ctx); err != nil {
+		return "", err
+	}
+	output, err := u.EKSPodIdentityDescriber.ListPodIdentityAssociations(ctx, &eks.ListPodIdentityAssociationsInput{
+		ClusterName:    aws.String(u.ClusterName),
+		Namespace:      aws.String(pia.Namespace),
+		ServiceAccount: aws.String(pia.ServiceAccountName),
+	})
+	if err != nil {
+		return "", fmt.Errorf("listing pod identity associations for %s/%s: %w", pia.Namespace, pia.ServiceAccountName, err)
+	}
+	if len(output.Associations) == 0 {
+		return "", nil
+	}
+	return aws.ToString(output.Associations[0].AssociationId), nil
+}
+
+func (u *PodIdentityAssociationUpdater) describeCurrentRoleARN(ctx context.Context, associationID string) (string, error) {
+	if err := u.waitForRateLimiter(ctx); err != nil {
+		return "", err
+	}
+	output, err := u.EKSPodIdentityDescriber.DescribePodIdentityAssociation(ctx, &eks.DescribePodIdentityAssociationInput{
+		ClusterName:   aws.String(u.ClusterName),
+		AssociationId: aws.String(associationID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing pod identity association %q: %w", associationID, err)
+	}
+	return aws.ToString(output.Association.RoleArn), nil
+}
+
+func (u *PodIdentityAssociationUpdater) isStackOwned(ctx context.Context, stackName string) (bool, error) {
+	if err := u.waitForRateLimiter(ctx); err != nil {
+		return false, err
+	}
+	_, err := u.StackDescriber.DescribeStack(ctx, &manager.Stack{StackName: aws.String(stackName)})
+	if err != nil {
+		if isStackNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// waitForRateLimiter blocks until RateLimiter permits another EKS or CloudFormation call. With no
+// RateLimiter configured, one is lazily created from defaultRateLimit/defaultRateBurst. The default
+// is established at most once via rateLimiterOnce, since UpdateRole calls this concurrently from
+// its reconcile goroutines.
+func (u *PodIdentityAssociationUpdater) waitForRateLimiter(ctx context.Context) error {
+	u.rateLimiterOnce.Do(func() {
+		if u.RateLimiter == nil {
+			u.RateLimiter = rate.NewLimiter(defaultRateLimit, defaultRateBurst)
+		}
+	})
+	return u.RateLimiter.Wait(ctx)
+}
+
+// isStackNotFound reports whether err is the CloudFormation "ValidationError" returned by
+// DescribeStack for a stack that does not exist.
+func isStackNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	return strings.Contains(err.Error(), "ValidationError")
+}
+
+// podIdentityRoleStackPrefix returns the part of podIdentityRoleStackName shared by every pod
+// identity role stack for addonName, i.e. podIdentityRoleStackName with namespace and
+// serviceAccountName omitted.
+func podIdentityRoleStackPrefix(clusterName, addonName string) string {
+	return fmt.Sprintf("eksctl-%s-addon-%s-podidentityrole-", clusterName, addonName)
+}
+
+// podIdentityRoleStackName derives the CloudFormation stack name backing a single pod identity
+// association's IAM role. Namespace and service account are joined with "--" so
+// parsePodIdentityRoleStackSuffix can recover the pair later; this keeps two service accounts
+// that share a name across different namespaces from colliding on the same stack. A namespace or
+// service account name that itself contains "--" (allowed, if unusual, under DNS-1123) would
+// still parse, just not necessarily at the same boundary it was generated with.
+func podIdentityRoleStackName(clusterName, addonName, namespace, serviceAccountName string) string {
+	return fmt.Sprintf("%s%s--%s", podIdentityRoleStackPrefix(clusterName, addonName), namespace, serviceAccountName)
+}
+
+// parsePodIdentityRoleStackSuffix recovers the namespace and service account name encoded by
+// podIdentityRoleStackName from a stack name known to start with prefix (podIdentityRoleStackPrefix's
+// output). It reports ok=false if stackName does not carry a well-formed namespace--serviceAccountName
+// suffix.
+func parsePodIdentityRoleStackSuffix(stackName, prefix string) (namespace, serviceAccountName string, ok bool) {
+	suffix := strings.TrimPrefix(stackName, prefix)
+	if suffix == "" || suffix == stackName {
+		return "", "", false
+	}
+	namespace, serviceAccountName, found := strings.Cut(suffix, "--")
+	if !found || namespace == "" || serviceAccountName == "" {
+		return "", "", false
+	}
+	return namespace, serviceAccountName, true
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/aws/smithy-go"
+	"golang.org/x/time/rate"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
@@ -29,18 +32,28 @@ import (
 
 var _ = Describe("Update Pod Identity Association", func() {
 	type piaMocks struct {
-		stackManager   *fakes.FakeStackUpdater
-		stackDescriber *piamocks.StackDescriber
-		roleCreator    *mocks.IAMRoleCreator
-		roleUpdater    *mocks.IAMRoleUpdater
-		eks            *mocksv2.EKS
+		stackManager            *fakes.FakeStackUpdater
+		stackDescriber          *piamocks.StackDescriber
+		roleCreator             *mocks.IAMRoleCreator
+		roleUpdater             *mocks.IAMRoleUpdater
+		irsaRoleFinder          *mocks.IRSARoleFinder
+		trustPolicyUpdater      *mocks.TrustPolicyUpdater
+		serviceAccountInspector *mocks.ServiceAccountInspector
+		eks                     *mocksv2.EKS
 	}
 	type updateEntry struct {
 		podIdentityAssociations []api.PodIdentityAssociation
 		mockCalls               func(m piaMocks)
+		dryRun                  bool
+		gated                   bool
+		concurrency             int
+		rateLimiter             *rate.Limiter
 
 		expectedCalls                        func(stackManager *managerfakes.FakeStackManager, eksAPI *mocksv2.EKS)
 		expectedAddonPodIdentityAssociations []ekstypes.AddonPodIdentityAssociations
+		expectedPlanRoleActions              []addon.RoleAction
+		expectedSkipped                      []addon.SkippedAssociation
+		expectedProviderTransitions          []addon.ProviderTransition
 
 		expectedErr string
 	}
@@ -108,10 +121,13 @@ var _ = Describe("Update Pod Identity Association", func() {
 	DescribeTable("update pod identity association", func(e updateEntry) {
 		provider := mockprovider.NewMockProvider()
 		var (
-			roleCreator    mocks.IAMRoleCreator
-			roleUpdater    mocks.IAMRoleUpdater
-			stackUpdater   fakes.FakeStackUpdater
-			stackDescriber piamocks.StackDescriber
+			roleCreator             mocks.IAMRoleCreator
+			roleUpdater             mocks.IAMRoleUpdater
+			stackUpdater            fakes.FakeStackUpdater
+			stackDescriber          piamocks.StackDescriber
+			irsaRoleFinder          mocks.IRSARoleFinder
+			trustPolicyUpdater      mocks.TrustPolicyUpdater
+			serviceAccountInspector mocks.ServiceAccountInspector
 		)
 
 		piaUpdater := &addon.PodIdentityAssociationUpdater{
@@ -120,23 +136,55 @@ var _ = Describe("Update Pod Identity Association", func() {
 			IAMRoleUpdater:          &roleUpdater,
 			EKSPodIdentityDescriber: provider.MockEKS(),
 			StackDescriber:          &stackDescriber,
+			IRSARoleFinder:          &irsaRoleFinder,
+			TrustPolicyUpdater:      &trustPolicyUpdater,
+		}
+		if e.gated {
+			piaUpdater.ServiceAccountInspector = &serviceAccountInspector
+		}
+		if e.concurrency > 0 {
+			piaUpdater.Concurrency = e.concurrency
+		}
+		if e.rateLimiter != nil {
+			piaUpdater.RateLimiter = e.rateLimiter
 		}
 		if e.mockCalls != nil {
 			e.mockCalls(piaMocks{
-				stackManager:   &stackUpdater,
-				stackDescriber: &stackDescriber,
-				roleCreator:    &roleCreator,
-				roleUpdater:    &roleUpdater,
-				eks:            provider.MockEKS(),
+				stackManager:            &stackUpdater,
+				stackDescriber:          &stackDescriber,
+				roleCreator:             &roleCreator,
+				roleUpdater:             &roleUpdater,
+				irsaRoleFinder:          &irsaRoleFinder,
+				trustPolicyUpdater:      &trustPolicyUpdater,
+				serviceAccountInspector: &serviceAccountInspector,
+				eks:                     provider.MockEKS(),
 			})
 		}
-		addonPodIdentityAssociations, err := piaUpdater.UpdateRole(context.Background(), e.podIdentityAssociations, "")
+		var updateOpts []addon.UpdateOption
+		var plan addon.UpdateRolePlan
+		if e.dryRun {
+			updateOpts = append(updateOpts, addon.WithDryRun())
+		}
+		updateOpts = append(updateOpts, addon.WithPlan(&plan))
+
+		result, err := piaUpdater.UpdateRole(context.Background(), e.podIdentityAssociations, "", updateOpts...)
 		if e.expectedErr != "" {
 			Expect(err).To(MatchError(ContainSubstring(e.expectedErr)))
 			return
 		}
 		Expect(err).NotTo(HaveOccurred())
-		Expect(addonPodIdentityAssociations).To(Equal(e.expectedAddonPodIdentityAssociations))
+		Expect(result.AddonPodIdentityAssociations).To(Equal(e.expectedAddonPodIdentityAssociations))
+		if e.expectedSkipped != nil {
+			Expect(result.Skipped).To(Equal(e.expectedSkipped))
+		}
+		if e.expectedPlanRoleActions != nil {
+			var actions []addon.RoleAction
+			for _, role := range plan.Roles {
+				actions = append(actions, role.Action)
+			}
+			Expect(actions).To(Equal(e.expectedPlanRoleActions))
+		}
+		Expect(plan.ProviderTransitions).To(Equal(e.expectedProviderTransitions))
 		t := GinkgoT()
 		roleCreator.AssertExpectations(t)
 		roleUpdater.AssertExpectations(t)
@@ -207,9 +255,9 @@ var _ = Describe("Update Pod Identity Association", func() {
 				m.roleUpdater.On("Update", mock.Anything, api.PodIdentityAssociation{
 					Namespace:          "kube-system",
 					ServiceAccountName: "vpc-cni",
-				}, "eksctl-test-addon--podidentityrole-vpc-cni", "a-1").Return("cni-role-2", true, nil).Once()
+				}, "eksctl-test-addon--podidentityrole-kube-system--vpc-cni", "a-1").Return("cni-role-2", true, nil).Once()
 				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
-					StackName: aws.String("eksctl-test-addon--podidentityrole-vpc-cni"),
+					StackName: aws.String("eksctl-test-addon--podidentityrole-kube-system--vpc-cni"),
 				}).Return(&manager.Stack{}, nil)
 
 				m.roleCreator.On("Create", mock.Anything, &api.PodIdentityAssociation{
@@ -290,7 +338,7 @@ var _ = Describe("Update Pod Identity Association", func() {
 				} {
 					id := makeID(i)
 
-					stackName := fmt.Sprintf("eksctl-test-addon--podidentityrole-%s", updateInput.serviceAccount)
+					stackName := fmt.Sprintf("eksctl-test-addon--podidentityrole-%s--%s", updateInput.namespace, updateInput.serviceAccount)
 					m.roleUpdater.On("Update", mock.Anything, api.PodIdentityAssociation{
 						Namespace:          updateInput.namespace,
 						ServiceAccountName: updateInput.serviceAccount,
@@ -430,13 +478,13 @@ var _ = Describe("Update Pod Identity Association", func() {
 				mockDescribePodIdentityAssociation(m.eks, "role-1", "role-2", "role-3")
 				for _, serviceAccount := range []string{"vpc-cni", "aws-ebs-csi-driver"} {
 					m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
-						StackName: aws.String(fmt.Sprintf("eksctl-test-addon--podidentityrole-%s", serviceAccount)),
+						StackName: aws.String(fmt.Sprintf("eksctl-test-addon--podidentityrole-kube-system--%s", serviceAccount)),
 					}).Return(nil, &smithy.OperationError{
 						Err: fmt.Errorf("ValidationError"),
 					}).Once()
 				}
 				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
-					StackName: aws.String("eksctl-test-addon--podidentityrole-karpenter"),
+					StackName: aws.String("eksctl-test-addon--podidentityrole-karpenter--karpenter"),
 				}).Return(&manager.Stack{}, nil).Once()
 			},
 			expectedErr: "cannot change podIdentityAssociation.roleARN since the role was created by eksctl",
@@ -459,15 +507,9 @@ var _ = Describe("Update Pod Identity Association", func() {
 				})
 				mockDescribePodIdentityAssociation(m.eks, "vpc-cni-role")
 				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
-					StackName: aws.String("eksctl-test-addon--podidentityrole-vpc-cni"),
+					StackName: aws.String("eksctl-test-addon--podidentityrole-kube-system--vpc-cni"),
 				}).Return(&manager.Stack{}, nil).Once()
 			},
-			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
-				{
-					RoleArn:        aws.String("vpc-cni-role-2"),
-					ServiceAccount: aws.String("vpc-cni"),
-				},
-			},
 			expectedErr: "cannot change podIdentityAssociation.roleARN since the role was created by eksctl",
 		}),
 
@@ -487,12 +529,500 @@ var _ = Describe("Update Pod Identity Association", func() {
 				})
 				mockDescribePodIdentityAssociation(m.eks, "vpc-cni-role")
 				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
-					StackName: aws.String("eksctl-test-addon--podidentityrole-vpc-cni"),
+					StackName: aws.String("eksctl-test-addon--podidentityrole-kube-system--vpc-cni"),
 				}).Return(nil, &smithy.OperationError{
 					Err: errors.New("ValidationError"),
 				})
 			},
 			expectedErr: "podIdentityAssociation.roleARN is required since the role was not created by eksctl",
 		}),
+
+		Entry("dry-run never mutates IAM roles or stacks", updateEntry{
+			dryRun: true,
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "vpc-cni",
+				},
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "aws-ebs-csi-driver",
+				},
+			},
+			mockCalls: func(m piaMocks) {
+				mockListPodIdentityAssociations(m.eks, true, []listPodIdentityInput{
+					{
+						namespace:      "kube-system",
+						serviceAccount: "vpc-cni",
+					},
+				})
+				mockDescribePodIdentityAssociation(m.eks, "cni-role")
+				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
+					StackName: aws.String("eksctl-test-addon--podidentityrole-kube-system--vpc-cni"),
+				}).Return(&manager.Stack{}, nil)
+
+				mockListPodIdentityAssociations(m.eks, false, []listPodIdentityInput{
+					{
+						namespace:      "kube-system",
+						serviceAccount: "aws-ebs-csi-driver",
+					},
+				})
+				// no roleCreator/roleUpdater expectations: dry-run must never call Create or Update.
+			},
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{
+					ServiceAccount: aws.String("vpc-cni"),
+					RoleArn:        aws.String("cni-role"),
+				},
+				{
+					ServiceAccount: aws.String("aws-ebs-csi-driver"),
+					RoleArn:        aws.String(""),
+				},
+			},
+			expectedPlanRoleActions: []addon.RoleAction{
+				addon.RoleActionUpdate,
+				addon.RoleActionCreate,
+			},
+		}),
+
+		Entry("addon contains a pod identity owned by an external identity provider", updateEntry{
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "vpc-cni",
+					IdentityOwner:      "external",
+					RoleARN:            "externally-managed-role",
+				},
+			},
+			// No EKS, roleCreator, roleUpdater or stackDescriber calls: the external owner is
+			// entirely hands-off.
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{
+					ServiceAccount: aws.String("vpc-cni"),
+					RoleArn:        aws.String("externally-managed-role"),
+				},
+			},
+			expectedPlanRoleActions: []addon.RoleAction{
+				addon.RoleActionUnchanged,
+			},
+		}),
+
+		Entry("addon contains a pod identity falling back to an existing IRSA role", updateEntry{
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "vpc-cni",
+					IdentityOwner:      "irsa-fallback",
+				},
+			},
+			mockCalls: func(m piaMocks) {
+				m.eks.On("ListPodIdentityAssociations", mock.Anything, &eks.ListPodIdentityAssociationsInput{
+					ClusterName:    aws.String(clusterName),
+					Namespace:      aws.String("kube-system"),
+					ServiceAccount: aws.String("vpc-cni"),
+				}).Return(&eks.ListPodIdentityAssociationsOutput{}, nil)
+				m.irsaRoleFinder.On("FindIRSARole", mock.Anything, "kube-system", "vpc-cni").Return("irsa-role", nil)
+				m.trustPolicyUpdater.On("UpdateTrustPolicy", mock.Anything, "irsa-role", "pods.eks.amazonaws.com").Return(nil)
+			},
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{
+					ServiceAccount: aws.String("vpc-cni"),
+					RoleArn:        aws.String("irsa-role"),
+				},
+			},
+			expectedPlanRoleActions: []addon.RoleAction{
+				addon.RoleActionUpdate,
+			},
+			// No pod identity association existed in EKS yet, so this reconcile is the moment
+			// the role's trust policy actually moves from trusting the OIDC provider to trusting
+			// pod identity.
+			expectedProviderTransitions: []addon.ProviderTransition{
+				{
+					Namespace:      "kube-system",
+					ServiceAccount: "vpc-cni",
+					From:           "irsa-fallback",
+					To:             "eksctl",
+				},
+			},
+		}),
+
+		Entry("addon contains a pod identity previously adopted from IRSA", updateEntry{
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "vpc-cni",
+					IdentityOwner:      "irsa-fallback",
+				},
+			},
+			mockCalls: func(m piaMocks) {
+				mockListPodIdentityAssociations(m.eks, true, []listPodIdentityInput{
+					{namespace: "kube-system", serviceAccount: "vpc-cni"},
+				})
+				m.irsaRoleFinder.On("FindIRSARole", mock.Anything, "kube-system", "vpc-cni").Return("irsa-role", nil)
+				m.trustPolicyUpdater.On("UpdateTrustPolicy", mock.Anything, "irsa-role", "pods.eks.amazonaws.com").Return(nil)
+			},
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{
+					ServiceAccount: aws.String("vpc-cni"),
+					RoleArn:        aws.String("irsa-role"),
+				},
+			},
+			expectedPlanRoleActions: []addon.RoleAction{
+				addon.RoleActionUpdate,
+			},
+			// A pod identity association already exists, so the adoption happened on an earlier
+			// reconcile; this run is not a new transition.
+			expectedProviderTransitions: nil,
+		}),
+
+		Entry("addon contains a pod identity for a service account that has not opted in", updateEntry{
+			gated: true,
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "vpc-cni",
+				},
+				{
+					Namespace:          "kube-system",
+					ServiceAccountName: "aws-ebs-csi-driver",
+				},
+			},
+			mockCalls: func(m piaMocks) {
+				m.serviceAccountInspector.On("HasManagedPodIdentityAnnotation", mock.Anything, "kube-system", "vpc-cni").Return(false, nil)
+				m.serviceAccountInspector.On("HasManagedPodIdentityAnnotation", mock.Anything, "kube-system", "aws-ebs-csi-driver").Return(true, nil)
+
+				m.eks.On("ListPodIdentityAssociations", mock.Anything, &eks.ListPodIdentityAssociationsInput{
+					ClusterName:    aws.String(clusterName),
+					Namespace:      aws.String("kube-system"),
+					ServiceAccount: aws.String("aws-ebs-csi-driver"),
+				}).Return(&eks.ListPodIdentityAssociationsOutput{}, nil)
+
+				m.roleCreator.On("Create", mock.Anything, &api.PodIdentityAssociation{
+					Namespace:          "kube-system",
+					ServiceAccountName: "aws-ebs-csi-driver",
+				}, "").Return("csi-role", nil)
+			},
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{
+					ServiceAccount: aws.String("aws-ebs-csi-driver"),
+					RoleArn:        aws.String("csi-role"),
+				},
+			},
+			expectedSkipped: []addon.SkippedAssociation{
+				{
+					Namespace:      "kube-system",
+					ServiceAccount: "vpc-cni",
+					Reason:         `service account kube-system/vpc-cni is missing the "eksctl.io/managed-pod-identity" annotation; skipping`,
+				},
+			},
+			expectedPlanRoleActions: []addon.RoleAction{
+				addon.RoleActionSkipped,
+				addon.RoleActionCreate,
+			},
+		}),
+
+		Entry("preserves input order when reconciling concurrently", updateEntry{
+			// RateLimiter is left unset, so this also exercises the concurrent default
+			// initialization of waitForRateLimiter's limiter under `go test -race`.
+			concurrency: 4,
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+				{Namespace: "kube-system", ServiceAccountName: "aws-ebs-csi-driver"},
+				{Namespace: "karpenter", ServiceAccountName: "karpenter"},
+				{Namespace: "external-dns", ServiceAccountName: "external-dns"},
+			},
+			mockCalls: func(m piaMocks) {
+				mockListPodIdentityAssociations(m.eks, false, []listPodIdentityInput{
+					{namespace: "kube-system", serviceAccount: "vpc-cni"},
+					{namespace: "kube-system", serviceAccount: "aws-ebs-csi-driver"},
+					{namespace: "karpenter", serviceAccount: "karpenter"},
+					{namespace: "external-dns", serviceAccount: "external-dns"},
+				})
+
+				// Associations are created out of order, with the first-listed service account
+				// finishing last, to exercise that UpdateRole still returns results in input order.
+				for sa, delay := range map[string]time.Duration{
+					"vpc-cni":             40 * time.Millisecond,
+					"aws-ebs-csi-driver":  30 * time.Millisecond,
+					"karpenter":           20 * time.Millisecond,
+					"external-dns":        10 * time.Millisecond,
+				} {
+					sa, delay := sa, delay
+					m.roleCreator.On("Create", mock.Anything, mock.MatchedBy(func(pia *api.PodIdentityAssociation) bool {
+						return pia.ServiceAccountName == sa
+					}), "").After(delay).Return(sa+"-role", nil).Once()
+				}
+			},
+			expectedAddonPodIdentityAssociations: []ekstypes.AddonPodIdentityAssociations{
+				{ServiceAccount: aws.String("vpc-cni"), RoleArn: aws.String("vpc-cni-role")},
+				{ServiceAccount: aws.String("aws-ebs-csi-driver"), RoleArn: aws.String("aws-ebs-csi-driver-role")},
+				{ServiceAccount: aws.String("karpenter"), RoleArn: aws.String("karpenter-role")},
+				{ServiceAccount: aws.String("external-dns"), RoleArn: aws.String("external-dns-role")},
+			},
+		}),
+
+		Entry("cancels sibling reconciliations when one association fails", updateEntry{
+			concurrency: 4,
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+				{Namespace: "karpenter", ServiceAccountName: "karpenter"},
+			},
+			mockCalls: func(m piaMocks) {
+				mockListPodIdentityAssociations(m.eks, false, []listPodIdentityInput{
+					{namespace: "kube-system", serviceAccount: "vpc-cni"},
+					{namespace: "karpenter", serviceAccount: "karpenter"},
+				})
+				m.roleCreator.On("Create", mock.Anything, mock.MatchedBy(func(pia *api.PodIdentityAssociation) bool {
+					return pia.ServiceAccountName == "vpc-cni"
+				}), "").Return("", errors.New("boom"))
+				// karpenter may or may not start before the group is cancelled; either outcome is
+				// acceptable, so its Create expectation is optional (Maybe).
+				m.roleCreator.On("Create", mock.Anything, mock.MatchedBy(func(pia *api.PodIdentityAssociation) bool {
+					return pia.ServiceAccountName == "karpenter"
+				}), "").After(50*time.Millisecond).Return("karpenter-role", nil).Maybe()
+			},
+			expectedErr: "boom",
+		}),
+
+		Entry("consults the configured rate limiter before making EKS calls", updateEntry{
+			rateLimiter: rate.NewLimiter(rate.Limit(1), 0),
+			podIdentityAssociations: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+			},
+			// A zero-burst limiter rejects the very first reservation, so RateLimiter.Wait fails
+			// before any EKS call is made; no mockCalls are needed.
+			expectedErr: "exceeds limiter's burst",
+		}),
+	)
+})
+
+var _ = Describe("Prune Pod Identity Associations", func() {
+	type pruneMocks struct {
+		stackLister                   *mocks.StackLister
+		stackDescriber                *piamocks.StackDescriber
+		stackDeleter                  *mocks.StackDeleter
+		podIdentityAssociationDeleter *mocks.PodIdentityAssociationDeleter
+		eks                           *mocksv2.EKS
+	}
+	type pruneEntry struct {
+		desired   []api.PodIdentityAssociation
+		deleteOpt bool
+		mockCalls func(m pruneMocks)
+
+		expectedOrphans []addon.OrphanedAssociation
+		expectedErr     string
+	}
+
+	const (
+		clusterName = "test"
+		addonName   = "vpc-cni"
+	)
+	orphanStackName := fmt.Sprintf("eksctl-%s-addon-%s-podidentityrole-kube-system--old-sa", clusterName, addonName)
+
+	DescribeTable("prune", func(e pruneEntry) {
+		provider := mockprovider.NewMockProvider()
+		var (
+			stackLister                   mocks.StackLister
+			stackDescriber                piamocks.StackDescriber
+			stackDeleter                  mocks.StackDeleter
+			podIdentityAssociationDeleter mocks.PodIdentityAssociationDeleter
+		)
+
+		piaUpdater := &addon.PodIdentityAssociationUpdater{
+			ClusterName:                   clusterName,
+			EKSPodIdentityDescriber:       provider.MockEKS(),
+			StackDescriber:                &stackDescriber,
+			StackLister:                   &stackLister,
+			StackDeleter:                  &stackDeleter,
+			PodIdentityAssociationDeleter: &podIdentityAssociationDeleter,
+		}
+		if e.mockCalls != nil {
+			e.mockCalls(pruneMocks{
+				stackLister:                   &stackLister,
+				stackDescriber:                &stackDescriber,
+				stackDeleter:                  &stackDeleter,
+				podIdentityAssociationDeleter: &podIdentityAssociationDeleter,
+				eks:                           provider.MockEKS(),
+			})
+		}
+
+		result, err := piaUpdater.Prune(context.Background(), e.desired, addonName, addon.PruneOptions{Delete: e.deleteOpt})
+		if e.expectedErr != "" {
+			Expect(err).To(MatchError(ContainSubstring(e.expectedErr)))
+			return
+		}
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Orphans).To(Equal(e.expectedOrphans))
+
+		t := GinkgoT()
+		stackLister.AssertExpectations(t)
+		stackDeleter.AssertExpectations(t)
+		podIdentityAssociationDeleter.AssertExpectations(t)
+		provider.MockEKS().AssertExpectations(t)
+	},
+		Entry("orphan with an eksctl-owned stack is reported and deleted", pruneEntry{
+			desired: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+			},
+			deleteOpt: true,
+			mockCalls: func(m pruneMocks) {
+				m.stackLister.On("ListStacksMatching", mock.Anything, "^"+regexp.QuoteMeta(fmt.Sprintf("eksctl-%s-addon-%s-podidentityrole-", clusterName, addonName))).
+					Return([]*manager.Stack{
+						{StackName: aws.String(orphanStackName)},
+					}, nil)
+
+				m.eks.On("ListPodIdentityAssociations", mock.Anything, &eks.ListPodIdentityAssociationsInput{
+					ClusterName:    aws.String(clusterName),
+					Namespace:      aws.String("kube-system"),
+					ServiceAccount: aws.String("old-sa"),
+				}).Return(&eks.ListPodIdentityAssociationsOutput{
+					Associations: []ekstypes.PodIdentityAssociationSummary{
+						{
+							Namespace:      aws.String("kube-system"),
+							ServiceAccount: aws.String("old-sa"),
+							AssociationId:  aws.String("assoc-1"),
+						},
+					},
+				}, nil)
+				m.eks.On("DescribePodIdentityAssociation", mock.Anything, &eks.DescribePodIdentityAssociationInput{
+					ClusterName:   aws.String(clusterName),
+					AssociationId: aws.String("assoc-1"),
+				}).Return(&eks.DescribePodIdentityAssociationOutput{
+					Association: &ekstypes.PodIdentityAssociation{
+						AssociationId: aws.String("assoc-1"),
+						RoleArn:       aws.String("old-role"),
+					},
+				}, nil)
+
+				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
+					StackName: aws.String(orphanStackName),
+				}).Return(&manager.Stack{StackName: aws.String(orphanStackName)}, nil)
+
+				m.podIdentityAssociationDeleter.On("DeletePodIdentityAssociation", mock.Anything, "assoc-1").Return(nil)
+				m.stackDeleter.On("DeleteStack", mock.Anything, &manager.Stack{StackName: aws.String(orphanStackName)}).Return(nil)
+			},
+			expectedOrphans: []addon.OrphanedAssociation{
+				{
+					Namespace:      "kube-system",
+					ServiceAccount: "old-sa",
+					AssociationID:  "assoc-1",
+					RoleARN:        "old-role",
+					StackName:      orphanStackName,
+					EksctlManaged:  true,
+					Deleted:        true,
+				},
+			},
+		}),
+
+		Entry("orphan with a user-supplied roleARN is deleted without touching the role", pruneEntry{
+			desired: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+			},
+			deleteOpt: true,
+			mockCalls: func(m pruneMocks) {
+				m.stackLister.On("ListStacksMatching", mock.Anything, mock.Anything).
+					Return([]*manager.Stack{
+						{StackName: aws.String(orphanStackName)},
+					}, nil)
+
+				m.eks.On("ListPodIdentityAssociations", mock.Anything, &eks.ListPodIdentityAssociationsInput{
+					ClusterName:    aws.String(clusterName),
+					Namespace:      aws.String("kube-system"),
+					ServiceAccount: aws.String("old-sa"),
+				}).Return(&eks.ListPodIdentityAssociationsOutput{
+					Associations: []ekstypes.PodIdentityAssociationSummary{
+						{
+							Namespace:      aws.String("kube-system"),
+							ServiceAccount: aws.String("old-sa"),
+							AssociationId:  aws.String("assoc-1"),
+						},
+					},
+				}, nil)
+				m.eks.On("DescribePodIdentityAssociation", mock.Anything, &eks.DescribePodIdentityAssociationInput{
+					ClusterName:   aws.String(clusterName),
+					AssociationId: aws.String("assoc-1"),
+				}).Return(&eks.DescribePodIdentityAssociationOutput{
+					Association: &ekstypes.PodIdentityAssociation{
+						AssociationId: aws.String("assoc-1"),
+						RoleArn:       aws.String("user-supplied-role"),
+					},
+				}, nil)
+
+				// No eksctl-owned stack was ever created for this association, because its roleARN was
+				// user-supplied: DescribeStack returns the CloudFormation "stack does not exist" error.
+				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
+					StackName: aws.String(orphanStackName),
+				}).Return(nil, &smithy.OperationError{Err: errors.New("ValidationError")})
+
+				m.podIdentityAssociationDeleter.On("DeletePodIdentityAssociation", mock.Anything, "assoc-1").Return(nil)
+				// StackDeleter must never be called: eksctl does not own this role, so it must not delete it.
+			},
+			expectedOrphans: []addon.OrphanedAssociation{
+				{
+					Namespace:      "kube-system",
+					ServiceAccount: "old-sa",
+					AssociationID:  "assoc-1",
+					RoleARN:        "user-supplied-role",
+					StackName:      orphanStackName,
+					EksctlManaged:  false,
+					Deleted:        true,
+					Reason:         "no eksctl-owned stack was found for this role; only the pod identity association was deleted, the IAM role was left untouched",
+				},
+			},
+		}),
+
+		Entry("orphan whose stack describe returns ValidationError is reported with its stack treated as already gone", pruneEntry{
+			desired: []api.PodIdentityAssociation{
+				{Namespace: "kube-system", ServiceAccountName: "vpc-cni"},
+			},
+			deleteOpt: false,
+			mockCalls: func(m pruneMocks) {
+				m.stackLister.On("ListStacksMatching", mock.Anything, mock.Anything).
+					Return([]*manager.Stack{
+						{StackName: aws.String(orphanStackName)},
+					}, nil)
+
+				m.eks.On("ListPodIdentityAssociations", mock.Anything, &eks.ListPodIdentityAssociationsInput{
+					ClusterName:    aws.String(clusterName),
+					Namespace:      aws.String("kube-system"),
+					ServiceAccount: aws.String("old-sa"),
+				}).Return(&eks.ListPodIdentityAssociationsOutput{
+					Associations: []ekstypes.PodIdentityAssociationSummary{
+						{
+							Namespace:      aws.String("kube-system"),
+							ServiceAccount: aws.String("old-sa"),
+							AssociationId:  aws.String("assoc-1"),
+						},
+					},
+				}, nil)
+				m.eks.On("DescribePodIdentityAssociation", mock.Anything, &eks.DescribePodIdentityAssociationInput{
+					ClusterName:   aws.String(clusterName),
+					AssociationId: aws.String("assoc-1"),
+				}).Return(&eks.DescribePodIdentityAssociationOutput{
+					Association: &ekstypes.PodIdentityAssociation{
+						AssociationId: aws.String("assoc-1"),
+						RoleArn:       aws.String("old-role"),
+					},
+				}, nil)
+
+				m.stackDescriber.On("DescribeStack", mock.Anything, &manager.Stack{
+					StackName: aws.String(orphanStackName),
+				}).Return(nil, &smithy.OperationError{Err: errors.New("ValidationError")})
+
+				// Delete was not requested: neither deleter should be called at all.
+			},
+			expectedOrphans: []addon.OrphanedAssociation{
+				{
+					Namespace:      "kube-system",
+					ServiceAccount: "old-sa",
+					AssociationID:  "assoc-1",
+					RoleARN:        "old-role",
+					StackName:      orphanStackName,
+					EksctlManaged:  false,
+					Deleted:        false,
+					Reason:         "orphaned; re-run with --prune to delete",
+				},
+			},
+		}),
 	)
 })
@@ -0,0 +1,53 @@
+package v1alpha5
+
+import "fmt"
+
+// PodIdentityAssociationOwner identifies which entity owns the lifecycle of the IAM role backing a
+// PodIdentityAssociation: eksctl itself, an external/manually managed role, or an existing IRSA
+// role being adopted for Pod Identity.
+type PodIdentityAssociationOwner string
+
+const (
+	// PodIdentityAssociationOwnerEksctl means eksctl creates and updates the IAM role backing this
+	// pod identity association, including its CloudFormation stack. This is the default when
+	// IdentityOwner is left unset.
+	PodIdentityAssociationOwnerEksctl PodIdentityAssociationOwner = "eksctl"
+	// PodIdentityAssociationOwnerExternal means the IAM role is managed entirely outside of eksctl;
+	// eksctl only passes RoleARN through to EKS and never creates, updates or deletes the role or any
+	// CloudFormation stack for it.
+	PodIdentityAssociationOwnerExternal PodIdentityAssociationOwner = "external"
+	// PodIdentityAssociationOwnerIRSAFallback means eksctl adopts the IAM role already attached to
+	// the service account via IRSA, rewriting its trust policy to trust Pod Identity instead of the
+	// cluster's OIDC provider.
+	PodIdentityAssociationOwnerIRSAFallback PodIdentityAssociationOwner = "irsa-fallback"
+)
+
+// PodIdentityAssociation represents an EKS Pod Identity Association: a binding between a
+// Kubernetes service account and an IAM role, used to grant pods AWS permissions without IRSA.
+type PodIdentityAssociation struct {
+	// ServiceAccountName is the name of the Kubernetes service account to be associated with this
+	// Pod Identity.
+	ServiceAccountName string `json:"serviceAccountName"`
+	// Namespace is the namespace of the Kubernetes service account to be associated with this Pod
+	// Identity.
+	Namespace string `json:"namespace,omitempty"`
+	// RoleARN is the ARN of the IAM role to associate with the service account. Required when
+	// IdentityOwner is "external", optional otherwise.
+	RoleARN string `json:"roleARN,omitempty"`
+	// IdentityOwner controls which entity owns the lifecycle of the IAM role backing this
+	// association. Defaults to PodIdentityAssociationOwnerEksctl.
+	// +optional
+	IdentityOwner PodIdentityAssociationOwner `json:"identityOwner,omitempty"`
+}
+
+// Validate sanity-checks the fields set on a PodIdentityAssociation.
+func (p *PodIdentityAssociation) Validate() error {
+	switch p.IdentityOwner {
+	case "", PodIdentityAssociationOwnerEksctl, PodIdentityAssociationOwnerExternal, PodIdentityAssociationOwnerIRSAFallback:
+		return nil
+	default:
+		return fmt.Errorf("invalid identityOwner %q for pod identity association of service account %q; must be one of %q, %q or %q",
+			p.IdentityOwner, p.ServiceAccountName,
+			PodIdentityAssociationOwnerEksctl, PodIdentityAssociationOwnerExternal, PodIdentityAssociationOwnerIRSAFallback)
+	}
+}